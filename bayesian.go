@@ -1,14 +1,20 @@
 package bayesian
 
 import (
+	"bytes"
+	"context"
 	"encoding/gob"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"math"
 	"os"
 	"path/filepath"
+	"sync"
 	"sync/atomic"
+
+	"github.com/edwsel/bayesian/features"
 )
 
 // defaultProb is the tiny non-zero probability that a word
@@ -18,27 +24,80 @@ const defaultProb = 0.00000000001
 // ErrUnderflow is returned when an underflow is detected.
 var ErrUnderflow = errors.New("possible underflow detected")
 
+// UnknownClass is returned as the index from FisherScores and
+// SafeFisherScores when the highest-scoring class does not clear its
+// entry in the classifier's Thresholds or Minimums.
+const UnknownClass = -1
+
+// Smoothing configures Laplace/Lidstone smoothing for word and
+// class-prior probabilities, so that a single unseen word does not
+// push a classifier's score all the way down to defaultProb
+// regardless of how strong the other evidence is.
+type Smoothing struct {
+	// Alpha is the smoothing pseudo-count added to every word and
+	// class count. Alpha == 0, the zero value, disables smoothing
+	// entirely and preserves the classifier's original behavior.
+	Alpha float64
+
+	// VocabSize is the size of the vocabulary used as the
+	// denominator term when smoothing word probabilities. While Alpha
+	// is non-zero, Learn and Observe keep it set to the union of word
+	// IDs observed across all classes; call
+	// (*Classifier).RecomputeVocab after changing class data by other
+	// means (e.g. ReadClassFromFile).
+	VocabSize int
+}
+
 // Class defines a class that the classifier will filter:
 // C = {C_1, ..., C_n}. You should define your classes as a
 // set of constants, for example as follows:
 //
-//    const (
-//        Good Class = "Good"
-//        Bad Class = "Bad
-//    )
+//	const (
+//	    Good Class = "Good"
+//	    Bad Class = "Bad
+//	)
 //
 // Class values should be unique.
 type Class string
 
-// Classifier implements the Naive Bayesian Classifier.
+// Classifier implements the Naive Bayesian Classifier. It is safe
+// for concurrent use: Learn/Observe/ConvertTermsFreqToTfIdf take an
+// internal write lock, and all scoring/query methods take a read
+// lock, so a classifier may be trained and queried from different
+// goroutines at once. To retrain without blocking readers for the
+// duration of training, build a fresh Classifier in the background
+// and hand it to SwapIn.
 type Classifier struct {
 	Classes         []Class
 	learned         int   // docs learned
 	seen            int64 // docs seen
+	mu              sync.RWMutex
 	datas           map[Class]*classData
+	corpus          *Corpus // assigns every seen word a stable int ID shared by all classes
 	tfIdf           bool
 	DidConvertTfIdf bool // we can't classify a TF-IDF classifier if we haven't yet
 	// called ConverTermsFreqToTfIdf
+
+	// Thresholds, when set, requires the winning class from
+	// FisherScores/SafeFisherScores to exceed every other class's
+	// score by the given multiplier, e.g. Thresholds[Bad] = 3 means
+	// scores[Bad] must be >= 3*scores[other] for every other class.
+	// A class with no entry is unconstrained. When the threshold is
+	// not cleared, UnknownClass is returned instead.
+	Thresholds map[Class]float64
+
+	// Minimums, when set, requires the winning class from
+	// FisherScores/SafeFisherScores to reach at least the given
+	// score before it can be selected. A class with no entry is
+	// unconstrained. When the minimum is not cleared, UnknownClass
+	// is returned instead.
+	Minimums map[Class]float64
+
+	// Smoothing configures Laplace/Lidstone smoothing of word and
+	// prior probabilities used by LogScores/ProbScores/SafeProbScores
+	// and WordFrequencies. The zero value disables smoothing and
+	// preserves the classifier's original behavior.
+	Smoothing Smoothing
 }
 
 // serializableClassifier represents a container for
@@ -51,34 +110,186 @@ type serializableClassifier struct {
 	Datas           map[Class]*classData `json:"datas"`
 	TfIdf           bool                 `json:"tf_idf"`
 	DidConvertTfIdf bool                 `json:"did_convert_tf_idf"`
+	Corpus          *Corpus              `json:"corpus"`
+	Thresholds      map[Class]float64    `json:"thresholds"`
+	Minimums        map[Class]float64    `json:"minimums"`
+	Smoothing       Smoothing            `json:"smoothing"`
 }
 
-// classData holds the frequency data for words in a
-// particular class. In the future, we may replace this
-// structure with a trie-like structure for more
-// efficient storage.
-type classData struct {
+// legacyClassData is classData as it was stored before words were
+// assigned Corpus IDs, kept around so that NewClassifierFromReader
+// and NewClassifierFromJson can migrate data saved by older versions
+// of this package.
+type legacyClassData struct {
 	Freqs   map[string]float64   `json:"freqs"`
 	FreqTfs map[string][]float64 `json:"freqTfs"`
 	Total   int                  `json:"total"`
 }
 
+// legacySerializableClassifier is serializableClassifier as it was
+// stored before the introduction of Corpus.
+type legacySerializableClassifier struct {
+	Classes         []Class                    `json:"classes"`
+	Learned         int                        `json:"learned"`
+	Seen            int                        `json:"seen"`
+	Datas           map[Class]*legacyClassData `json:"datas"`
+	TfIdf           bool                       `json:"tf_idf"`
+	DidConvertTfIdf bool                       `json:"did_convert_tf_idf"`
+}
+
+// classifierFromLegacy migrates a classifier saved in the pre-Corpus,
+// string-keyed format to the current int-keyed representation.
+func classifierFromLegacy(w *legacySerializableClassifier) *Classifier {
+	corpus := newCorpus()
+	datas := make(map[Class]*classData, len(w.Datas))
+	for class, old := range w.Datas {
+		data := newClassData()
+		data.Total = old.Total
+		for word, freq := range old.Freqs {
+			data.Freqs[corpus.Add(word)] = freq
+		}
+		for word, tfs := range old.FreqTfs {
+			data.FreqTfs[corpus.Add(word)] = tfs
+		}
+		datas[class] = data
+	}
+
+	return &Classifier{
+		Classes:         w.Classes,
+		learned:         w.Learned,
+		seen:            int64(w.Seen),
+		datas:           datas,
+		tfIdf:           w.TfIdf,
+		DidConvertTfIdf: w.DidConvertTfIdf,
+		corpus:          corpus,
+	}
+}
+
+// Corpus assigns a stable integer ID to each distinct word a
+// Classifier has ever seen, so that classData can key its frequency
+// maps by int instead of storing every word as its own string once
+// per class -- a significant saving for TF-IDF classifiers, where
+// every training document appends to FreqTfs.
+type Corpus struct {
+	Words []string       `json:"words"` // id -> word
+	ids   map[string]int // word -> id, rebuilt from Words after deserializing
+}
+
+// newCorpus creates a new empty Corpus.
+func newCorpus() *Corpus {
+	return &Corpus{ids: make(map[string]int)}
+}
+
+// Add returns the ID for word, assigning it the next free ID if it
+// has not been seen before.
+func (v *Corpus) Add(word string) int {
+	if id, ok := v.ids[word]; ok {
+		return id
+	}
+	id := len(v.Words)
+	v.ids[word] = id
+	v.Words = append(v.Words, word)
+	return id
+}
+
+// ID returns the ID assigned to word, and whether word has been
+// added to the corpus at all.
+func (v *Corpus) ID(word string) (int, bool) {
+	id, ok := v.ids[word]
+	return id, ok
+}
+
+// Word returns the word assigned to id. It panics if id is out of range.
+func (v *Corpus) Word(id int) string {
+	return v.Words[id]
+}
+
+// lookupAll looks up the Corpus ID for every word in words, in
+// order, so that callers scoring several classes against the same
+// document only pay for the string lookups once.
+func (v *Corpus) lookupAll(words []string) (ids []int, oks []bool) {
+	ids = make([]int, len(words))
+	oks = make([]bool, len(words))
+	for i, word := range words {
+		ids[i], oks[i] = v.ID(word)
+	}
+	return
+}
+
+// rebuildIndex reconstructs the word -> id lookup table from Words,
+// which is all that gob/json persist of a Corpus.
+func (v *Corpus) rebuildIndex() {
+	v.ids = make(map[string]int, len(v.Words))
+	for id, word := range v.Words {
+		v.ids[word] = id
+	}
+}
+
+// clone returns a deep copy of v.
+func (v *Corpus) clone() *Corpus {
+	ids := make(map[string]int, len(v.ids))
+	for word, id := range v.ids {
+		ids[word] = id
+	}
+	return &Corpus{Words: append([]string(nil), v.Words...), ids: ids}
+}
+
+// classData holds the frequency data for words in a
+// particular class, keyed by each word's ID in the Classifier's
+// Corpus. In the future, we may replace this structure with a
+// trie-like structure for more efficient storage.
+type classData struct {
+	Freqs   map[int]float64   `json:"freqs"`
+	FreqTfs map[int][]float64 `json:"freqTfs"`
+	Total   int               `json:"total"`
+}
+
 // newClassData creates a new empty classData node.
 func newClassData() *classData {
 	return &classData{
-		Freqs:   make(map[string]float64),
-		FreqTfs: make(map[string][]float64),
+		Freqs:   make(map[int]float64),
+		FreqTfs: make(map[int][]float64),
 	}
 }
 
-// getWordProb returns P(W|C_j) -- the probability of seeing
-// a particular word W in a document of this class.
-func (d *classData) getWordProb(word string) float64 {
-	value, ok := d.Freqs[word]
-	if !ok {
-		return defaultProb
+// clone returns a deep copy of d, so that the copy can be read or
+// written independently of the original.
+func (d *classData) clone() *classData {
+	freqs := make(map[int]float64, len(d.Freqs))
+	for id, freq := range d.Freqs {
+		freqs[id] = freq
 	}
-	return value / float64(d.Total)
+	freqTfs := make(map[int][]float64, len(d.FreqTfs))
+	for id, tfs := range d.FreqTfs {
+		freqTfs[id] = append([]float64(nil), tfs...)
+	}
+	return &classData{Freqs: freqs, FreqTfs: freqTfs, Total: d.Total}
+}
+
+// getWordProb returns P(W|C_j) -- the probability of seeing the word
+// with the given Corpus id in a document of this class. ok should be
+// false when the word has never been added to the Corpus at all.
+//
+// When smoothing.Alpha is 0 (the default), an unseen word returns
+// the hard-coded defaultProb. Otherwise Laplace/Lidstone smoothing
+// is applied: (Freqs[id] + Alpha) / (Total + Alpha*VocabSize).
+func (d *classData) getWordProb(id int, ok bool, smoothing Smoothing) float64 {
+	if smoothing.Alpha == 0 {
+		if !ok {
+			return defaultProb
+		}
+		value, seen := d.Freqs[id]
+		if !seen {
+			return defaultProb
+		}
+		return value / float64(d.Total)
+	}
+
+	var freq float64
+	if ok {
+		freq = d.Freqs[id]
+	}
+	return (freq + smoothing.Alpha) / (float64(d.Total) + smoothing.Alpha*float64(smoothing.VocabSize))
 }
 
 // getWordsProb returns P(D|C_j) -- the probability of seeing
@@ -87,10 +298,11 @@ func (d *classData) getWordProb(word string) float64 {
 // Note that words should not be empty, and this method of
 // calulation is prone to underflow if there are many words
 // and their individual probabilties are small.
-func (d *classData) getWordsProb(words []string) (prob float64) {
+func (d *classData) getWordsProb(corpus *Corpus, words []string, smoothing Smoothing) (prob float64) {
 	prob = 1
 	for _, word := range words {
-		prob *= d.getWordProb(word)
+		id, ok := corpus.ID(word)
+		prob *= d.getWordProb(id, ok, smoothing)
 	}
 	return
 }
@@ -118,6 +330,7 @@ func NewClassifierTfIdf(classes ...Class) (c *Classifier) {
 	c = &Classifier{
 		Classes: classes,
 		datas:   make(map[Class]*classData, n),
+		corpus:  newCorpus(),
 		tfIdf:   true,
 	}
 	for _, class := range classes {
@@ -149,6 +362,7 @@ func NewClassifier(classes ...Class) (c *Classifier) {
 	c = &Classifier{
 		Classes:         classes,
 		datas:           make(map[Class]*classData, n),
+		corpus:          newCorpus(),
 		tfIdf:           false,
 		DidConvertTfIdf: false,
 	}
@@ -158,6 +372,42 @@ func NewClassifier(classes ...Class) (c *Classifier) {
 	return
 }
 
+// NewClassifierWithSmoothing returns a new classifier, as with
+// NewClassifier, configured to use Laplace/Lidstone smoothing with
+// the given alpha in place of the hard-coded defaultProb for unseen
+// words. Smoothing.VocabSize is kept up to date automatically by
+// Learn and Observe; call RecomputeVocab yourself only if you mutate
+// c.datas by some other means (e.g. ReadClassFromFile).
+func NewClassifierWithSmoothing(alpha float64, classes ...Class) (c *Classifier) {
+	c = NewClassifier(classes...)
+	c.Smoothing = Smoothing{Alpha: alpha}
+	return
+}
+
+// RecomputeVocab recomputes Smoothing.VocabSize as the size of the
+// union of word IDs observed across all classes' Freqs. Learn and
+// Observe already call this for you whenever smoothing is enabled;
+// it is exported so that callers who populate c.datas by some other
+// means (e.g. ReadClassFromFile) can bring VocabSize back in sync.
+func (c *Classifier) RecomputeVocab() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.recomputeVocabLocked()
+}
+
+// recomputeVocabLocked does the work for RecomputeVocab. Callers must
+// already hold c.mu.
+func (c *Classifier) recomputeVocabLocked() {
+	seen := make(map[int]struct{})
+	for _, class := range c.Classes {
+		for id := range c.datas[class].Freqs {
+			seen[id] = struct{}{}
+		}
+	}
+	c.Smoothing.VocabSize = len(seen)
+}
+
 // NewClassifierFromFile loads an existing classifier from
 // file. The classifier was previously saved with a call
 // to c.WriteToFile(string).
@@ -173,38 +423,79 @@ func NewClassifierFromFile(name string) (c *Classifier, err error) {
 
 // NewClassifierFromReader This actually does the deserializing of a Gob encoded classifier
 func NewClassifierFromReader(r io.Reader) (c *Classifier, err error) {
-	dec := gob.NewDecoder(r)
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
 	w := new(serializableClassifier)
-	err = dec.Decode(w)
+	if decErr := gob.NewDecoder(bytes.NewReader(raw)).Decode(w); decErr != nil {
+		// r may hold a classifier saved before Corpus existed, where
+		// Freqs/FreqTfs were keyed directly by word. Fall back to
+		// that format and migrate it.
+		legacy := new(legacySerializableClassifier)
+		if gob.NewDecoder(bytes.NewReader(raw)).Decode(legacy) != nil {
+			return nil, decErr
+		}
+		return classifierFromLegacy(legacy), nil
+	}
 
-	return &Classifier{w.Classes, w.Learned, int64(w.Seen), w.Datas, w.TfIdf, w.DidConvertTfIdf}, err
+	if w.Corpus == nil {
+		w.Corpus = newCorpus()
+	}
+	w.Corpus.rebuildIndex()
+
+	return &Classifier{
+		Classes:         w.Classes,
+		learned:         w.Learned,
+		seen:            int64(w.Seen),
+		datas:           w.Datas,
+		corpus:          w.Corpus,
+		tfIdf:           w.TfIdf,
+		DidConvertTfIdf: w.DidConvertTfIdf,
+		Thresholds:      w.Thresholds,
+		Minimums:        w.Minimums,
+		Smoothing:       w.Smoothing,
+	}, nil
 }
 
 // NewClassifierFromJson This actually does the deserializing of a Gob encoded classifier
 func NewClassifierFromJson(data []byte) (c *Classifier, err error) {
 	w := new(serializableClassifier)
 
-	err = json.Unmarshal(data, w)
+	if jsonErr := json.Unmarshal(data, w); jsonErr != nil {
+		// data may hold a classifier saved before Corpus existed,
+		// where Freqs/FreqTfs were keyed directly by word. Fall
+		// back to that format and migrate it.
+		legacy := new(legacySerializableClassifier)
+		if json.Unmarshal(data, legacy) != nil {
+			return nil, jsonErr
+		}
+		return classifierFromLegacy(legacy), nil
+	}
 
-	if err != nil {
-		return nil, err
+	if w.Corpus == nil {
+		w.Corpus = newCorpus()
 	}
+	w.Corpus.rebuildIndex()
 
 	return &Classifier{
-		w.Classes,
-		w.Learned,
-		int64(w.Seen),
-		w.Datas,
-		w.TfIdf,
-		w.DidConvertTfIdf,
-	}, err
+		Classes:         w.Classes,
+		learned:         w.Learned,
+		seen:            int64(w.Seen),
+		datas:           w.Datas,
+		corpus:          w.Corpus,
+		tfIdf:           w.TfIdf,
+		DidConvertTfIdf: w.DidConvertTfIdf,
+		Thresholds:      w.Thresholds,
+		Minimums:        w.Minimums,
+		Smoothing:       w.Smoothing,
+	}, nil
 }
 
 // getPriors returns the prior probabilities for the
-// classes provided -- P(C_j).
-//
-// TODO: There is a way to smooth priors, currently
-// not implemented here.
+// classes provided -- P(C_j), smoothed per c.Smoothing when
+// c.Smoothing.Alpha is non-zero.
 func (c *Classifier) getPriors() (priors []float64) {
 	n := len(c.Classes)
 	priors = make([]float64, n, n)
@@ -214,6 +505,12 @@ func (c *Classifier) getPriors() (priors []float64) {
 		priors[index] = float64(total)
 		sum += total
 	}
+	if alpha := c.Smoothing.Alpha; alpha != 0 {
+		for i := 0; i < n; i++ {
+			priors[i] = (priors[i] + alpha) / (float64(sum) + alpha*float64(n))
+		}
+		return
+	}
 	if sum != 0 {
 		for i := 0; i < n; i++ {
 			priors[i] /= float64(sum)
@@ -225,6 +522,8 @@ func (c *Classifier) getPriors() (priors []float64) {
 // Learned returns the number of documents ever learned
 // in the lifetime of this classifier.
 func (c *Classifier) Learned() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return c.learned
 }
 
@@ -242,6 +541,9 @@ func (c *Classifier) IsTfIdf() bool {
 // WordCount returns the number of words counted for
 // each class in the lifetime of the classifier.
 func (c *Classifier) WordCount() (result []int) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	result = make([]int, len(c.Classes))
 	for inx, class := range c.Classes {
 		data := c.datas[class]
@@ -253,14 +555,23 @@ func (c *Classifier) WordCount() (result []int) {
 // Observe should be used when word-frequencies have been already been learned
 // externally (e.g., hadoop)
 func (c *Classifier) Observe(word string, count int, which Class) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	data := c.datas[which]
-	data.Freqs[word] += float64(count)
+	data.Freqs[c.corpus.Add(word)] += float64(count)
 	data.Total += count
+
+	if c.Smoothing.Alpha != 0 {
+		c.recomputeVocabLocked()
+	}
 }
 
 // Learn will accept new training documents for
 // supervised learning.
 func (c *Classifier) Learn(document []string, which Class) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
 	// If we are a tfidf classifier we first need to get terms as
 	// terms frequency and store that to work out the idf part later
@@ -271,9 +582,9 @@ func (c *Classifier) Learn(document []string, which Class) {
 		}
 
 		// Term Frequency: word count in document / document length
-		docTf := make(map[string]float64)
+		docTf := make(map[int]float64)
 		for _, word := range document {
-			docTf[word]++
+			docTf[c.corpus.Add(word)]++
 		}
 
 		docLen := float64(len(document))
@@ -288,16 +599,32 @@ func (c *Classifier) Learn(document []string, which Class) {
 
 	data := c.datas[which]
 	for _, word := range document {
-		data.Freqs[word]++
+		data.Freqs[c.corpus.Add(word)]++
 		data.Total++
 	}
 	c.learned++
+
+	if c.Smoothing.Alpha != 0 {
+		c.recomputeVocabLocked()
+	}
+}
+
+// LearnWithTemplates is a convenience wrapper around Learn for
+// classifying short, sparse strings -- usernames, domains, log
+// tokens -- where whole-word features are too sparse on their own.
+// It expands doc with features.ApplyTemplates(tmpls, doc) before
+// learning it, so the caller does not have to call ApplyTemplates
+// itself.
+func (c *Classifier) LearnWithTemplates(doc []string, which Class, tmpls []features.Template) {
+	c.Learn(features.ApplyTemplates(tmpls, doc), which)
 }
 
 // ConvertTermsFreqToTfIdf uses all the TF samples for the class and converts
 // them to TF-IDF https://en.wikipedia.org/wiki/Tf%E2%80%93idf
 // once we have finished learning all the classes and have the totals.
 func (c *Classifier) ConvertTermsFreqToTfIdf() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
 	if c.DidConvertTfIdf {
 		panic("Cannot call ConvertTermsFreqToTfIdf more than once. Reset and relearn to reconvert.")
@@ -326,6 +653,106 @@ func (c *Classifier) ConvertTermsFreqToTfIdf() {
 
 }
 
+// hasClass reports whether which is one of c.Classes.
+func (c *Classifier) hasClass(which Class) bool {
+	for _, class := range c.Classes {
+		if class == which {
+			return true
+		}
+	}
+	return false
+}
+
+// TrainingSample pairs a training document with the class it should
+// be learned under, for use with OnlineLearn.
+type TrainingSample struct {
+	Document []string
+	Class    Class
+}
+
+// OnlineLearn consumes samples from stream, calling Learn for each,
+// until stream is closed or ctx is cancelled. Per-sample problems
+// (an unknown class, or an empty document) are reported on errs
+// without stopping consumption of the stream; errs is never closed
+// by OnlineLearn and may be nil to discard these errors. This lets a
+// classifier be trained directly from an HTTP handler or log tailer
+// without the caller having to write its own worker goroutine around
+// Learn.
+func (c *Classifier) OnlineLearn(ctx context.Context, stream <-chan TrainingSample, errs chan<- error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sample, ok := <-stream:
+			if !ok {
+				return
+			}
+			if len(sample.Document) == 0 {
+				c.sendOnlineErr(ctx, errs, fmt.Errorf("bayesian: empty document for class %q", sample.Class))
+				continue
+			}
+			if !c.hasClass(sample.Class) {
+				c.sendOnlineErr(ctx, errs, fmt.Errorf("bayesian: unknown class %q", sample.Class))
+				continue
+			}
+			c.Learn(sample.Document, sample.Class)
+		}
+	}
+}
+
+// sendOnlineErr delivers err on errs, but gives up once ctx is done
+// so that a slow or absent error consumer cannot block training.
+func (c *Classifier) sendOnlineErr(ctx context.Context, errs chan<- error, err error) {
+	if errs == nil {
+		return
+	}
+	select {
+	case errs <- err:
+	case <-ctx.Done():
+	}
+}
+
+// ClassificationResult bundles the outcome of classifying a single
+// document with OnlineClassify.
+type ClassificationResult struct {
+	Scores []float64
+	Inx    int
+	Strict bool
+	Err    error
+}
+
+// OnlineClassify consumes documents from in, classifying each with
+// LogScores and sending the result on out, until in is closed or ctx
+// is cancelled. An empty document is reported as a ClassificationResult
+// with Err set rather than being scored. This lets a classifier be
+// queried directly from an HTTP pipeline without the caller having
+// to write its own worker goroutine around LogScores.
+func (c *Classifier) OnlineClassify(ctx context.Context, in <-chan []string, out chan<- ClassificationResult) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case document, ok := <-in:
+			if !ok {
+				return
+			}
+
+			var result ClassificationResult
+			if len(document) == 0 {
+				result.Err = errors.New("bayesian: empty document")
+			} else {
+				result.Scores, result.Inx, result.Strict = c.LogScores(document)
+			}
+
+			select {
+			case out <- result:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
 // LogScores produces "log-likelihood"-like scores that can
 // be used to classify documents into classes.
 //
@@ -346,6 +773,9 @@ func (c *Classifier) ConvertTermsFreqToTfIdf() {
 // Unlike c.Probabilities(), this function is not prone to
 // floating point underflow and is relatively safe to use.
 func (c *Classifier) LogScores(document []string) (scores []float64, inx int, strict bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	if c.tfIdf && !c.DidConvertTfIdf {
 		panic("Using a TF-IDF classifier. Please call ConvertTermsFreqToTfIdf before calling LogScores.")
 	}
@@ -353,6 +783,7 @@ func (c *Classifier) LogScores(document []string) (scores []float64, inx int, st
 	n := len(c.Classes)
 	scores = make([]float64, n, n)
 	priors := c.getPriors()
+	ids, oks := c.corpus.lookupAll(document)
 
 	// calculate the score for each class
 	for index, class := range c.Classes {
@@ -360,8 +791,8 @@ func (c *Classifier) LogScores(document []string) (scores []float64, inx int, st
 		// c is the sum of the logarithms
 		// as outlined in the refresher
 		score := math.Log(priors[index])
-		for _, word := range document {
-			score += math.Log(data.getWordProb(word))
+		for i := range document {
+			score += math.Log(data.getWordProb(ids[i], oks[i], c.Smoothing))
 		}
 		scores[index] = score
 	}
@@ -381,6 +812,9 @@ func (c *Classifier) LogScores(document []string) (scores []float64, inx int, st
 // may or may not be a concern. Consider using SafeProbScores()
 // instead.
 func (c *Classifier) ProbScores(doc []string) (scores []float64, inx int, strict bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	if c.tfIdf && !c.DidConvertTfIdf {
 		panic("Using a TF-IDF classifier. Please call ConvertTermsFreqToTfIdf before calling ProbScores.")
 	}
@@ -388,14 +822,15 @@ func (c *Classifier) ProbScores(doc []string) (scores []float64, inx int, strict
 	scores = make([]float64, n, n)
 	priors := c.getPriors()
 	sum := float64(0)
+	ids, oks := c.corpus.lookupAll(doc)
 	// calculate the score for each class
 	for index, class := range c.Classes {
 		data := c.datas[class]
 		// c is the sum of the logarithms
 		// as outlined in the refresher
 		score := priors[index]
-		for _, word := range doc {
-			score *= data.getWordProb(word)
+		for i := range doc {
+			score *= data.getWordProb(ids[i], oks[i], c.Smoothing)
 		}
 		scores[index] = score
 		sum += score
@@ -420,6 +855,9 @@ func (c *Classifier) ProbScores(doc []string) (scores []float64, inx int, strict
 // Underflow detection is more costly because it also
 // has to make additional log score calculations.
 func (c *Classifier) SafeProbScores(doc []string) (scores []float64, inx int, strict bool, err error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	if c.tfIdf && !c.DidConvertTfIdf {
 		panic("Using a TF-IDF classifier. Please call ConvertTermsFreqToTfIdf before calling SafeProbScores.")
 	}
@@ -429,6 +867,7 @@ func (c *Classifier) SafeProbScores(doc []string) (scores []float64, inx int, st
 	logScores := make([]float64, n, n)
 	priors := c.getPriors()
 	sum := float64(0)
+	ids, oks := c.corpus.lookupAll(doc)
 	// calculate the score for each class
 	for index, class := range c.Classes {
 		data := c.datas[class]
@@ -436,8 +875,8 @@ func (c *Classifier) SafeProbScores(doc []string) (scores []float64, inx int, st
 		// as outlined in the refresher
 		score := priors[index]
 		logScore := math.Log(priors[index])
-		for _, word := range doc {
-			p := data.getWordProb(word)
+		for i := range doc {
+			p := data.getWordProb(ids[i], oks[i], c.Smoothing)
 			score *= p
 			logScore += math.Log(p)
 		}
@@ -461,22 +900,166 @@ func (c *Classifier) SafeProbScores(doc []string) (scores []float64, inx int, st
 	return scores, inx, strict, err
 }
 
+// wordClassProb returns the Fisher-method per-class feature
+// probability p(C|w) = freq(w,C)/total(w), where total(w) is the
+// word's summed frequency across all classes. Unseen words return
+// the neutral probability 0.5.
+func (c *Classifier) wordClassProb(word string, which Class) float64 {
+	id, ok := c.corpus.ID(word)
+	if !ok {
+		return 0.5
+	}
+
+	total := float64(0)
+	for _, class := range c.Classes {
+		total += c.datas[class].Freqs[id]
+	}
+	if total == 0 {
+		return 0.5
+	}
+
+	prob := c.datas[which].Freqs[id] / total
+	if prob == 0 {
+		// Clamp to the same epsilon LogScores/ProbScores use for an
+		// unseen word. A word seen only in other classes would
+		// otherwise score exactly 0 here, sending log(0) to -Inf and
+		// destabilizing invChiSquare's series expansion with a NaN.
+		return defaultProb
+	}
+	return prob
+}
+
+// invChiSquare approximates the inverse chi-square CDF using the
+// standard series expansion, turning a Fisher combined score into a
+// probability in [0, 1]. df must be even.
+func invChiSquare(chi2 float64, df int) float64 {
+	m := chi2 / 2
+	term := math.Exp(-m)
+	sum := term
+	for i := 1; i < df/2; i++ {
+		term *= m / float64(i)
+		sum += term
+	}
+	return math.Min(sum, 1.0)
+}
+
+// fisherScore combines the per-word class probabilities for document
+// into a single class score using Fisher's method, as described in
+// "Programming Collective Intelligence".
+func (c *Classifier) fisherScore(document []string, which Class) float64 {
+	sumLog := float64(0)
+	for _, word := range document {
+		sumLog += math.Log(c.wordClassProb(word, which))
+	}
+	return invChiSquare(-2*sumLog, 2*len(document))
+}
+
+// classifyFisher picks the winning class from a set of Fisher scores,
+// honoring Thresholds and Minimums, falling back to UnknownClass when
+// either is not satisfied.
+func (c *Classifier) classifyFisher(scores []float64) (inx int, strict bool) {
+	inx, strict = findMax(scores)
+
+	if c.Minimums != nil {
+		if min, ok := c.Minimums[c.Classes[inx]]; ok && scores[inx] < min {
+			return UnknownClass, false
+		}
+	}
+
+	if c.Thresholds != nil {
+		if threshold, ok := c.Thresholds[c.Classes[inx]]; ok {
+			for i, score := range scores {
+				if i == inx {
+					continue
+				}
+				if scores[inx] < threshold*score {
+					return UnknownClass, false
+				}
+			}
+		}
+	}
+
+	return inx, strict
+}
+
+// FisherScores produces classification scores using Fisher's method,
+// an alternative to the Naive-Bayes-style multiplication performed
+// by LogScores/ProbScores that is less sensitive to word-count skew.
+//
+// Each per-class score is computed by combining the document's
+// per-word class probabilities with -2*sum(log(p)) and passing the
+// result through the inverse chi-square CDF, giving a score in
+// [0, 1]. The index j of the score corresponds to the class given by
+// c.Classes[j].
+//
+// Additionally returned are "inx" and "strict" values, following the
+// same convention as LogScores, except that if Thresholds or
+// Minimums are configured and not cleared by the winning class, inx
+// is UnknownClass.
+func (c *Classifier) FisherScores(document []string) (scores []float64, inx int, strict bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.tfIdf && !c.DidConvertTfIdf {
+		panic("Using a TF-IDF classifier. Please call ConvertTermsFreqToTfIdf before calling FisherScores.")
+	}
+
+	n := len(c.Classes)
+	scores = make([]float64, n, n)
+	for index, class := range c.Classes {
+		scores[index] = c.fisherScore(document, class)
+	}
+	inx, strict = c.classifyFisher(scores)
+	atomic.AddInt64(&c.seen, 1)
+	return scores, inx, strict
+}
+
+// SafeFisherScores works the same as FisherScores, but returns
+// ErrUnderflow when any class's combined score is +Inf, -Inf or NaN,
+// so the caller can decide how to handle it. A word observed in other
+// classes but never in this one does not trigger this: its per-class
+// probability is clamped to defaultProb rather than 0.
+func (c *Classifier) SafeFisherScores(document []string) (scores []float64, inx int, strict bool, err error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.tfIdf && !c.DidConvertTfIdf {
+		panic("Using a TF-IDF classifier. Please call ConvertTermsFreqToTfIdf before calling SafeFisherScores.")
+	}
+
+	n := len(c.Classes)
+	scores = make([]float64, n, n)
+	for index, class := range c.Classes {
+		scores[index] = c.fisherScore(document, class)
+		if math.IsInf(scores[index], 0) || math.IsNaN(scores[index]) {
+			err = ErrUnderflow
+		}
+	}
+	inx, strict = c.classifyFisher(scores)
+	atomic.AddInt64(&c.seen, 1)
+	return scores, inx, strict, err
+}
+
 // WordFrequencies returns a matrix of word frequencies that currently
 // exist in the classifier for each class state for the given input
 // words. In other words, if you obtain the frequencies
 //
-//    freqs := c.WordFrequencies(/* [j]string */)
+//	freqs := c.WordFrequencies(/* [j]string */)
 //
 // then the expression freq[i][j] represents the frequency of the j-th
 // word within the i-th class.
 func (c *Classifier) WordFrequencies(words []string) (freqMatrix [][]float64) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	n, l := len(c.Classes), len(words)
+	ids, oks := c.corpus.lookupAll(words)
 	freqMatrix = make([][]float64, n)
 	for i := range freqMatrix {
 		arr := make([]float64, l)
 		data := c.datas[c.Classes[i]]
 		for j := range arr {
-			arr[j] = data.getWordProb(words[j])
+			arr[j] = data.getWordProb(ids[j], oks[j], c.Smoothing)
 		}
 		freqMatrix[i] = arr
 	}
@@ -486,9 +1069,12 @@ func (c *Classifier) WordFrequencies(words []string) (freqMatrix [][]float64) {
 // WordsByClass returns a map of words and their probability of
 // appearing in the given class.
 func (c *Classifier) WordsByClass(class Class) (freqMap map[string]float64) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	freqMap = make(map[string]float64)
-	for word, cnt := range c.datas[class].Freqs {
-		freqMap[word] = cnt / float64(c.datas[class].Total)
+	for id, cnt := range c.datas[class].Freqs {
+		freqMap[c.corpus.Word(id)] = cnt / float64(c.datas[class].Total)
 	}
 
 	return freqMap
@@ -509,8 +1095,11 @@ func (c *Classifier) WriteToFile(name string) (err error) {
 
 // WriteClassesToFile writes all classes to file.
 func (c *Classifier) WriteClassesToFile(rootPath string) (err error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	for name := range c.datas {
-		err = c.WriteClassToFile(name, rootPath)
+		err = c.writeClassToFile(name, rootPath)
 	}
 
 	return
@@ -518,7 +1107,35 @@ func (c *Classifier) WriteClassesToFile(rootPath string) (err error) {
 
 // WriteClassToFile writes a single class to file.
 func (c *Classifier) WriteClassToFile(name Class, rootPath string) (err error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.writeClassToFile(name, rootPath)
+}
+
+// writeClassToFile does the actual work for WriteClassToFile, and is
+// called directly by WriteClassesToFile so that it does not need to
+// re-acquire the read lock for every class.
+//
+// The file is encoded as a legacyClassData -- word strings rather
+// than opaque Corpus IDs -- so that a single class's data is
+// self-contained and can be read back by ReadClassFromFile into any
+// classifier, regardless of what that classifier's Corpus already
+// contains.
+func (c *Classifier) writeClassToFile(name Class, rootPath string) (err error) {
 	data := c.datas[name]
+	out := &legacyClassData{
+		Freqs:   make(map[string]float64, len(data.Freqs)),
+		FreqTfs: make(map[string][]float64, len(data.FreqTfs)),
+		Total:   data.Total,
+	}
+	for id, freq := range data.Freqs {
+		out.Freqs[c.corpus.Word(id)] = freq
+	}
+	for id, tfs := range data.FreqTfs {
+		out.FreqTfs[c.corpus.Word(id)] = tfs
+	}
+
 	fileName := filepath.Join(rootPath, string(name))
 	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE, 0644)
 	if err != nil {
@@ -527,20 +1144,35 @@ func (c *Classifier) WriteClassToFile(name Class, rootPath string) (err error) {
 	defer file.Close()
 
 	enc := gob.NewEncoder(file)
-	err = enc.Encode(data)
+	err = enc.Encode(out)
 	return
 }
 
 // WriteTo serializes this classifier to GOB and write to Writer.
 func (c *Classifier) WriteTo(w io.Writer) (n int64, err error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	enc := gob.NewEncoder(w)
-	err = enc.Encode(&serializableClassifier{c.Classes, c.learned, int(c.seen), c.datas, c.tfIdf, c.DidConvertTfIdf})
+	err = enc.Encode(&serializableClassifier{
+		Classes:         c.Classes,
+		Learned:         c.learned,
+		Seen:            int(atomic.LoadInt64(&c.seen)),
+		Datas:           c.datas,
+		TfIdf:           c.tfIdf,
+		DidConvertTfIdf: c.DidConvertTfIdf,
+		Corpus:          c.corpus,
+		Thresholds:      c.Thresholds,
+		Minimums:        c.Minimums,
+		Smoothing:       c.Smoothing,
+	})
 
 	return
 }
 
 // ReadClassFromFile loads existing class data from a
-// file.
+// file written by WriteClassToFile/WriteClassesToFile, reconciling
+// its word strings against this classifier's Corpus.
 func (c *Classifier) ReadClassFromFile(class Class, location string) (err error) {
 	fileName := filepath.Join(location, string(class))
 	file, err := os.Open(fileName)
@@ -551,22 +1183,120 @@ func (c *Classifier) ReadClassFromFile(class Class, location string) (err error)
 	defer file.Close()
 
 	dec := gob.NewDecoder(file)
-	w := new(classData)
-	err = dec.Decode(w)
+	w := new(legacyClassData)
+	if err = dec.Decode(w); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := newClassData()
+	data.Total = w.Total
+	for word, freq := range w.Freqs {
+		data.Freqs[c.corpus.Add(word)] = freq
+	}
+	for word, tfs := range w.FreqTfs {
+		data.FreqTfs[c.corpus.Add(word)] = tfs
+	}
 
 	c.learned++
-	c.datas[class] = w
-	return
+	c.datas[class] = data
+	return nil
+}
+
+// Snapshot returns a deep copy of the classifier, safe to classify
+// against from any goroutine independently of further Learn/Observe
+// calls made on the original. This is the "Working" half of the
+// Learning-vs-Working pattern: keep training the original in the
+// background and periodically hand out fresh snapshots to readers.
+func (c *Classifier) Snapshot() *Classifier {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	datas := make(map[Class]*classData, len(c.datas))
+	for class, data := range c.datas {
+		datas[class] = data.clone()
+	}
+
+	return &Classifier{
+		Classes:         append([]Class(nil), c.Classes...),
+		learned:         c.learned,
+		seen:            atomic.LoadInt64(&c.seen),
+		datas:           datas,
+		corpus:          c.corpus.clone(),
+		tfIdf:           c.tfIdf,
+		DidConvertTfIdf: c.DidConvertTfIdf,
+		Thresholds:      cloneFloatMap(c.Thresholds),
+		Minimums:        cloneFloatMap(c.Minimums),
+		Smoothing:       c.Smoothing,
+	}
+}
+
+// SwapIn atomically replaces c's learned state with other's. This is
+// the "Learning" half of the Learning-vs-Working pattern: train
+// other from scratch in the background, then SwapIn it into the
+// classifier serving live traffic without downtime. other must have
+// been built with the same Classes, in the same order, and the same
+// tfIdf mode as c, or an error is returned and c is left untouched.
+func (c *Classifier) SwapIn(other *Classifier) error {
+	other.mu.RLock()
+	datas := make(map[Class]*classData, len(other.datas))
+	for class, data := range other.datas {
+		datas[class] = data.clone()
+	}
+	corpus := other.corpus.clone()
+	learned := other.learned
+	seen := atomic.LoadInt64(&other.seen)
+	tfIdf := other.tfIdf
+	didConvertTfIdf := other.DidConvertTfIdf
+	thresholds := cloneFloatMap(other.Thresholds)
+	minimums := cloneFloatMap(other.Minimums)
+	smoothing := other.Smoothing
+	otherClasses := append([]Class(nil), other.Classes...)
+	other.mu.RUnlock()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(otherClasses) != len(c.Classes) {
+		return errors.New("bayesian: SwapIn classes do not match")
+	}
+	for i, class := range c.Classes {
+		if otherClasses[i] != class {
+			return errors.New("bayesian: SwapIn classes do not match")
+		}
+	}
+	if tfIdf != c.tfIdf {
+		return errors.New("bayesian: SwapIn tfIdf mode does not match")
+	}
+
+	c.datas = datas
+	c.corpus = corpus
+	c.learned = learned
+	atomic.StoreInt64(&c.seen, seen)
+	c.DidConvertTfIdf = didConvertTfIdf
+	c.Thresholds = thresholds
+	c.Minimums = minimums
+	c.Smoothing = smoothing
+	return nil
 }
 
 func (c *Classifier) ToJson() ([]byte, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	data := &serializableClassifier{
-		c.Classes,
-		c.learned,
-		int(c.seen),
-		c.datas,
-		c.tfIdf,
-		c.DidConvertTfIdf,
+		Classes:         c.Classes,
+		Learned:         c.learned,
+		Seen:            int(atomic.LoadInt64(&c.seen)),
+		Datas:           c.datas,
+		TfIdf:           c.tfIdf,
+		DidConvertTfIdf: c.DidConvertTfIdf,
+		Corpus:          c.corpus,
+		Thresholds:      c.Thresholds,
+		Minimums:        c.Minimums,
+		Smoothing:       c.Smoothing,
 	}
 
 	result, err := json.Marshal(data)
@@ -578,18 +1308,41 @@ func (c *Classifier) ToJson() ([]byte, error) {
 	return result, nil
 }
 
+// cloneFloatMap returns a shallow copy of m, preserving a nil m as nil.
+func cloneFloatMap(m map[Class]float64) map[Class]float64 {
+	if m == nil {
+		return nil
+	}
+	out := make(map[Class]float64, len(m))
+	for class, value := range m {
+		out[class] = value
+	}
+	return out
+}
+
 // findMax finds the maximum of a set of scores; if the
 // maximum is strict -- that is, it is the single unique
 // maximum from the set -- then strict has return value
 // true. Otherwise it is false.
+//
+// A NaN score never wins: NaN compares false against everything
+// (including itself), so without this it could sit unchallenged at
+// inx and be reported as a confident winner. NaN is instead treated
+// as losing to any non-NaN score, and tying only with another NaN.
 func findMax(scores []float64) (inx int, strict bool) {
 	inx = 0
 	strict = true
 	for i := 1; i < len(scores); i++ {
-		if scores[inx] < scores[i] {
+		switch {
+		case math.IsNaN(scores[inx]):
+			inx = i
+			strict = !math.IsNaN(scores[i])
+		case math.IsNaN(scores[i]):
+			// scores[inx] is not NaN, so it keeps winning.
+		case scores[inx] < scores[i]:
 			inx = i
 			strict = true
-		} else if scores[inx] == scores[i] {
+		case scores[inx] == scores[i]:
 			strict = false
 		}
 	}
@@ -0,0 +1,146 @@
+package bayesian
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+const (
+	testGood Class = "Good"
+	testBad  Class = "Bad"
+)
+
+// TestFisherScoresDisjointVocab covers the common training shape
+// where a word appears under only one class (e.g. "viagra" only
+// ever trained as Bad). Before this word's feature probability was
+// clamped away from exactly 0, such a word drove the other class's
+// Fisher score to NaN, and findMax reported that NaN class as the
+// confident winner.
+func TestFisherScoresDisjointVocab(t *testing.T) {
+	c := NewClassifier(testGood, testBad)
+	c.Learn([]string{"cheap", "offer", "free"}, testGood)
+	c.Learn([]string{"cheap", "viagra", "buy"}, testBad)
+
+	scores, inx, strict := c.FisherScores([]string{"cheap", "viagra"})
+	for i, score := range scores {
+		if math.IsNaN(score) {
+			t.Fatalf("scores[%d] is NaN (scores=%v)", i, scores)
+		}
+	}
+	if inx != 1 {
+		t.Fatalf("expected Bad (inx=1) to win on its exclusive word, got inx=%d strict=%v scores=%v", inx, strict, scores)
+	}
+}
+
+// TestFindMaxIgnoresNaN ensures a NaN score never wins: it must lose
+// to any real score, and only tie with another NaN.
+func TestFindMaxIgnoresNaN(t *testing.T) {
+	inx, strict := findMax([]float64{math.NaN(), 1, 0})
+	if inx != 1 || !strict {
+		t.Fatalf("expected inx=1 strict=true, got inx=%d strict=%v", inx, strict)
+	}
+
+	inx, strict = findMax([]float64{1, math.NaN(), 0})
+	if inx != 0 || !strict {
+		t.Fatalf("expected inx=0 strict=true, got inx=%d strict=%v", inx, strict)
+	}
+
+	_, strict = findMax([]float64{math.NaN(), math.NaN()})
+	if strict {
+		t.Fatalf("expected strict=false when every score is NaN")
+	}
+}
+
+// TestSmoothingSurvivesJsonRoundTrip guards against Smoothing,
+// Thresholds and Minimums being silently dropped by ToJson /
+// NewClassifierFromJson, reverting a configured classifier back to
+// the hard-coded defaultProb behavior with no error.
+func TestSmoothingSurvivesJsonRoundTrip(t *testing.T) {
+	c := NewClassifierWithSmoothing(1.0, testGood, testBad)
+	c.Smoothing.VocabSize = 100
+	c.Thresholds = map[Class]float64{testBad: 3}
+	c.Minimums = map[Class]float64{testGood: 0.5}
+	c.Learn([]string{"cheap", "offer"}, testGood)
+	c.Learn([]string{"cheap", "viagra"}, testBad)
+
+	data, err := c.ToJson()
+	if err != nil {
+		t.Fatalf("ToJson: %v", err)
+	}
+
+	got, err := NewClassifierFromJson(data)
+	if err != nil {
+		t.Fatalf("NewClassifierFromJson: %v", err)
+	}
+
+	if got.Smoothing != c.Smoothing {
+		t.Fatalf("Smoothing did not survive round trip: got %+v, want %+v", got.Smoothing, c.Smoothing)
+	}
+	if got.Thresholds[testBad] != c.Thresholds[testBad] {
+		t.Fatalf("Thresholds did not survive round trip: got %v, want %v", got.Thresholds, c.Thresholds)
+	}
+	if got.Minimums[testGood] != c.Minimums[testGood] {
+		t.Fatalf("Minimums did not survive round trip: got %v, want %v", got.Minimums, c.Minimums)
+	}
+}
+
+// TestSmoothingVocabSizeUpdatesAutomatically guards against the
+// common train-then-classify case silently smoothing with a zero
+// vocabulary: Learn and Observe must keep Smoothing.VocabSize in
+// sync without the caller remembering to call RecomputeVocab.
+func TestSmoothingVocabSizeUpdatesAutomatically(t *testing.T) {
+	c := NewClassifierWithSmoothing(1.0, testGood, testBad)
+	if c.Smoothing.VocabSize != 0 {
+		t.Fatalf("expected a fresh classifier to start with VocabSize=0, got %d", c.Smoothing.VocabSize)
+	}
+
+	c.Learn([]string{"cheap", "offer"}, testGood)
+	if c.Smoothing.VocabSize != 2 {
+		t.Fatalf("expected VocabSize=2 after learning 2 distinct words, got %d", c.Smoothing.VocabSize)
+	}
+
+	c.Learn([]string{"cheap", "viagra"}, testBad)
+	if c.Smoothing.VocabSize != 3 {
+		t.Fatalf("expected VocabSize=3 after learning a 3rd distinct word, got %d", c.Smoothing.VocabSize)
+	}
+
+	c.Observe("buy", 1, testBad)
+	if c.Smoothing.VocabSize != 4 {
+		t.Fatalf("expected VocabSize=4 after Observe'ing a 4th distinct word, got %d", c.Smoothing.VocabSize)
+	}
+
+	for _, class := range c.Classes {
+		prob := c.datas[class].getWordProb(0, true, c.Smoothing)
+		if prob > 1 {
+			t.Fatalf("getWordProb returned %v > 1 for class %v; VocabSize=0 footgun regressed", prob, class)
+		}
+	}
+}
+
+// TestSmoothingSurvivesGobRoundTrip is the WriteTo/NewClassifierFromReader
+// analogue of TestSmoothingSurvivesJsonRoundTrip.
+func TestSmoothingSurvivesGobRoundTrip(t *testing.T) {
+	c := NewClassifierWithSmoothing(0.5, testGood, testBad)
+	c.Smoothing.VocabSize = 42
+	c.Thresholds = map[Class]float64{testBad: 2}
+	c.Learn([]string{"cheap", "offer"}, testGood)
+	c.Learn([]string{"cheap", "viagra"}, testBad)
+
+	var buf bytes.Buffer
+	if _, err := c.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+
+	got, err := NewClassifierFromReader(&buf)
+	if err != nil {
+		t.Fatalf("NewClassifierFromReader: %v", err)
+	}
+
+	if got.Smoothing != c.Smoothing {
+		t.Fatalf("Smoothing did not survive round trip: got %+v, want %+v", got.Smoothing, c.Smoothing)
+	}
+	if got.Thresholds[testBad] != c.Thresholds[testBad] {
+		t.Fatalf("Thresholds did not survive round trip: got %v, want %v", got.Thresholds, c.Thresholds)
+	}
+}
@@ -0,0 +1,102 @@
+package bayesian
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestConcurrentLearnAndClassify drives Learn, LogScores and Snapshot
+// from many goroutines at once. It exists to be run with
+// -race: it doesn't assert much about the resulting scores beyond
+// "didn't panic, didn't race", since the classifier's exact state at
+// any instant is a race by design.
+func TestConcurrentLearnAndClassify(t *testing.T) {
+	c := NewClassifier(testGood, testBad)
+	c.Learn([]string{"cheap", "offer"}, testGood)
+	c.Learn([]string{"cheap", "viagra"}, testBad)
+
+	docs := [][]string{
+		{"cheap", "offer"},
+		{"cheap", "viagra"},
+		{"free", "buy"},
+	}
+
+	var wg sync.WaitGroup
+	const goroutines = 8
+	const iterations = 50
+
+	wg.Add(goroutines * 4)
+
+	for g := 0; g < goroutines; g++ {
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				c.Learn(docs[i%len(docs)], testGood)
+			}
+		}(g)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				c.Learn(docs[i%len(docs)], testBad)
+			}
+		}(g)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				c.LogScores(docs[i%len(docs)])
+			}
+		}(g)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				snap := c.Snapshot()
+				snap.LogScores(docs[i%len(docs)])
+			}
+		}(g)
+	}
+
+	wg.Wait()
+}
+
+// TestSwapIn checks that SwapIn atomically replaces a classifier's
+// learned state, and rejects a classifier built with different
+// classes rather than leaving c partially updated.
+func TestSwapIn(t *testing.T) {
+	live := NewClassifier(testGood, testBad)
+	live.Learn([]string{"cheap", "offer"}, testGood)
+
+	trained := NewClassifier(testGood, testBad)
+	trained.Learn([]string{"cheap", "viagra"}, testBad)
+	trained.Learn([]string{"viagra", "viagra"}, testBad)
+
+	if err := live.SwapIn(trained); err != nil {
+		t.Fatalf("SwapIn: %v", err)
+	}
+
+	got := live.WordsByClass(testBad)
+	if got["viagra"] == 0 {
+		t.Fatalf("expected live to carry trained's data after SwapIn, got %v", got)
+	}
+
+	mismatched := NewClassifier(testGood, testBad, "Ugly")
+	if err := live.SwapIn(mismatched); err == nil {
+		t.Fatalf("expected SwapIn to reject a classifier with different classes")
+	}
+}
+
+// TestSnapshotIsIndependent checks that a Snapshot is unaffected by
+// further Learn calls on the classifier it was taken from.
+func TestSnapshotIsIndependent(t *testing.T) {
+	c := NewClassifier(testGood, testBad)
+	c.Learn([]string{"cheap", "offer"}, testGood)
+
+	snap := c.Snapshot()
+	before := snap.WordsByClass(testGood)["cheap"]
+
+	c.Learn([]string{"cheap", "cheap", "cheap"}, testGood)
+
+	after := snap.WordsByClass(testGood)["cheap"]
+	if before != after {
+		t.Fatalf("expected snapshot to be unaffected by further Learn calls, got %v before, %v after", before, after)
+	}
+}
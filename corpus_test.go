@@ -0,0 +1,95 @@
+package bayesian
+
+import (
+	"bytes"
+	"encoding/gob"
+	"math"
+	"testing"
+)
+
+// TestWriteReadClassFromFileRoundTrip guards WriteClassToFile /
+// ReadClassFromFile's word strings against a Corpus-keyed classData:
+// the file must be self-contained (word strings, not opaque Corpus
+// IDs) so that reading it back -- even into a classifier whose Corpus
+// already has unrelated entries -- reconciles correctly instead of
+// panicking in Corpus.Word or silently mapping the wrong words.
+func TestWriteReadClassFromFileRoundTrip(t *testing.T) {
+	src := NewClassifier(testGood, testBad)
+	src.Learn([]string{"cheap", "offer", "cheap"}, testGood)
+	src.Learn([]string{"cheap", "viagra"}, testBad)
+
+	dir := t.TempDir()
+	if err := src.WriteClassesToFile(dir); err != nil {
+		t.Fatalf("WriteClassesToFile: %v", err)
+	}
+
+	// dst's Corpus already has unrelated entries assigned to IDs that
+	// collide with src's, so a bare int-keyed round trip would load
+	// the wrong words instead of panicking outright.
+	dst := NewClassifier(testGood, testBad)
+	dst.Learn([]string{"unrelated", "words", "here"}, testGood)
+
+	if err := dst.ReadClassFromFile(testGood, dir); err != nil {
+		t.Fatalf("ReadClassFromFile(Good): %v", err)
+	}
+	if err := dst.ReadClassFromFile(testBad, dir); err != nil {
+		t.Fatalf("ReadClassFromFile(Bad): %v", err)
+	}
+
+	got := dst.WordsByClass(testGood)
+	want := map[string]float64{"cheap": 2.0 / 3, "offer": 1.0 / 3}
+	for word, freq := range want {
+		if got[word] != freq {
+			t.Fatalf("WordsByClass(Good)[%q] = %v, want %v (got=%v)", word, got[word], freq, got)
+		}
+	}
+
+	got = dst.WordsByClass(testBad)
+	want = map[string]float64{"cheap": 0.5, "viagra": 0.5}
+	for word, freq := range want {
+		if got[word] != freq {
+			t.Fatalf("WordsByClass(Bad)[%q] = %v, want %v (got=%v)", word, got[word], freq, got)
+		}
+	}
+}
+
+// TestClassifierFromLegacyMigration covers the pre-Corpus,
+// string-keyed format migration path: NewClassifierFromReader must
+// fall back to it and produce a classifier whose Corpus/classData are
+// correctly keyed by the new int IDs.
+func TestClassifierFromLegacyMigration(t *testing.T) {
+	legacy := &legacySerializableClassifier{
+		Classes: []Class{testGood, testBad},
+		Learned: 2,
+		Seen:    0,
+		Datas: map[Class]*legacyClassData{
+			testGood: {Freqs: map[string]float64{"cheap": 1, "offer": 1}, Total: 2},
+			testBad:  {Freqs: map[string]float64{"cheap": 1, "viagra": 1}, Total: 2},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(legacy); err != nil {
+		t.Fatalf("encode legacy: %v", err)
+	}
+
+	c, err := NewClassifierFromReader(&buf)
+	if err != nil {
+		t.Fatalf("NewClassifierFromReader: %v", err)
+	}
+
+	got := c.WordsByClass(testBad)
+	if got["viagra"] != 0.5 {
+		t.Fatalf("WordsByClass(Bad)[\"viagra\"] = %v, want 0.5 (got=%v)", got["viagra"], got)
+	}
+
+	scores, inx, _ := c.FisherScores([]string{"cheap", "viagra"})
+	for i, score := range scores {
+		if math.IsNaN(score) {
+			t.Fatalf("scores[%d] is NaN after legacy migration (scores=%v)", i, scores)
+		}
+	}
+	if inx != 1 {
+		t.Fatalf("expected Bad (inx=1) to win after legacy migration, got inx=%d scores=%v", inx, scores)
+	}
+}
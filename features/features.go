@@ -0,0 +1,118 @@
+// Package features provides template-based feature extraction for
+// short, sparse strings -- usernames, domains, log tokens -- where
+// whole-word features are too sparse for a bayesian.Classifier to
+// learn from directly.
+package features
+
+import (
+	"strconv"
+	"unicode"
+)
+
+// Template generates additional feature strings for a single word,
+// to be learned alongside the word itself.
+type Template func(word string) []string
+
+// ApplyTemplates runs every template in tmpls over every token and
+// returns tokens with every generated feature appended. The result
+// can be passed directly to the Learn/LogScores family of methods on
+// bayesian.Classifier.
+func ApplyTemplates(tmpls []Template, tokens []string) []string {
+	out := make([]string, 0, len(tokens))
+	out = append(out, tokens...)
+	for _, token := range tokens {
+		for _, tmpl := range tmpls {
+			out = append(out, tmpl(token)...)
+		}
+	}
+	return out
+}
+
+// Prefixes returns a Template generating one feature per prefix
+// length from 1 to n, e.g. Prefixes(3)("hello") yields "pre1:h",
+// "pre2:he" and "pre3:hel".
+func Prefixes(n int) Template {
+	return func(word string) []string {
+		runes := []rune(word)
+		var feats []string
+		for i := 1; i <= n && i <= len(runes); i++ {
+			feats = append(feats, "pre"+strconv.Itoa(i)+":"+string(runes[:i]))
+		}
+		return feats
+	}
+}
+
+// Suffixes returns a Template generating one feature per suffix
+// length from 1 to n, e.g. Suffixes(3)("hello") yields "suf1:o",
+// "suf2:lo" and "suf3:llo".
+func Suffixes(n int) Template {
+	return func(word string) []string {
+		runes := []rune(word)
+		var feats []string
+		for i := 1; i <= n && i <= len(runes); i++ {
+			feats = append(feats, "suf"+strconv.Itoa(i)+":"+string(runes[len(runes)-i:]))
+		}
+		return feats
+	}
+}
+
+// CharNGrams returns a Template generating every overlapping
+// character n-gram of word, e.g. CharNGrams(3)("hello") yields
+// "gram3:hel", "gram3:ell" and "gram3:llo". Words shorter than n
+// generate no features.
+func CharNGrams(n int) Template {
+	return func(word string) []string {
+		runes := []rune(word)
+		if len(runes) < n {
+			return nil
+		}
+		feats := make([]string, 0, len(runes)-n+1)
+		for i := 0; i+n <= len(runes); i++ {
+			feats = append(feats, "gram"+strconv.Itoa(n)+":"+string(runes[i:i+n]))
+		}
+		return feats
+	}
+}
+
+// HasDigit is a Template yielding a "has-digit" feature for any word
+// containing at least one digit.
+func HasDigit(word string) []string {
+	for _, r := range word {
+		if unicode.IsDigit(r) {
+			return []string{"has-digit"}
+		}
+	}
+	return nil
+}
+
+// HasUppercase is a Template yielding a "has-uppercase" feature for
+// any word containing at least one uppercase letter.
+func HasUppercase(word string) []string {
+	for _, r := range word {
+		if unicode.IsUpper(r) {
+			return []string{"has-uppercase"}
+		}
+	}
+	return nil
+}
+
+// WordShape is a Template yielding a single "shape:..." feature that
+// maps every uppercase letter to 'X', every lowercase letter to 'x'
+// and every digit to '9', e.g. WordShape("Foo123") yields
+// "shape:Xxx999".
+func WordShape(word string) []string {
+	shape := make([]rune, 0, len(word))
+	for _, r := range word {
+		switch {
+		case unicode.IsUpper(r):
+			shape = append(shape, 'X')
+		case unicode.IsLower(r):
+			shape = append(shape, 'x')
+		case unicode.IsDigit(r):
+			shape = append(shape, '9')
+		default:
+			shape = append(shape, r)
+		}
+	}
+	return []string{"shape:" + string(shape)}
+}
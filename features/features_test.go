@@ -0,0 +1,74 @@
+package features
+
+import "testing"
+
+func TestPrefixes(t *testing.T) {
+	got := Prefixes(3)("hello")
+	want := []string{"pre1:h", "pre2:he", "pre3:hel"}
+	assertFeatures(t, got, want)
+
+	if got := Prefixes(3)("hi"); len(got) != 2 {
+		t.Fatalf("expected a word shorter than n to stop at its own length, got %v", got)
+	}
+}
+
+func TestSuffixes(t *testing.T) {
+	got := Suffixes(3)("hello")
+	want := []string{"suf1:o", "suf2:lo", "suf3:llo"}
+	assertFeatures(t, got, want)
+}
+
+func TestCharNGrams(t *testing.T) {
+	got := CharNGrams(3)("hello")
+	want := []string{"gram3:hel", "gram3:ell", "gram3:llo"}
+	assertFeatures(t, got, want)
+
+	if got := CharNGrams(3)("hi"); got != nil {
+		t.Fatalf("expected a word shorter than n to generate no features, got %v", got)
+	}
+}
+
+func TestHasDigit(t *testing.T) {
+	if got := HasDigit("abc123"); len(got) != 1 {
+		t.Fatalf("expected a feature for a word with a digit, got %v", got)
+	}
+	if got := HasDigit("abc"); got != nil {
+		t.Fatalf("expected no feature for a word without a digit, got %v", got)
+	}
+}
+
+func TestHasUppercase(t *testing.T) {
+	if got := HasUppercase("Abc"); len(got) != 1 {
+		t.Fatalf("expected a feature for a word with an uppercase letter, got %v", got)
+	}
+	if got := HasUppercase("abc"); got != nil {
+		t.Fatalf("expected no feature for an all-lowercase word, got %v", got)
+	}
+}
+
+func TestWordShape(t *testing.T) {
+	got := WordShape("Foo123")
+	want := []string{"shape:Xxx999"}
+	assertFeatures(t, got, want)
+}
+
+func TestApplyTemplates(t *testing.T) {
+	tokens := []string{"Foo1"}
+	tmpls := []Template{HasDigit, HasUppercase}
+
+	got := ApplyTemplates(tmpls, tokens)
+	want := []string{"Foo1", "has-digit", "has-uppercase"}
+	assertFeatures(t, got, want)
+}
+
+func assertFeatures(t *testing.T, got, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i, feat := range want {
+		if got[i] != feat {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package bayesian
+
+import "testing"
+
+// TestFisherScoresWorkedExample checks FisherScores' actual math on a
+// small, hand-computable corpus where both classes see every word.
+func TestFisherScoresWorkedExample(t *testing.T) {
+	c := NewClassifier(testGood, testBad)
+	c.Learn([]string{"cheap", "offer"}, testGood)
+	c.Learn([]string{"cheap", "cheap", "offer"}, testBad)
+
+	scores, inx, _ := c.FisherScores([]string{"cheap", "offer"})
+
+	// p(Good|cheap) = 1/3, p(Good|offer) = 1/2 -> sumLog is more
+	// negative for Good than for Bad (p(Bad|cheap) = 2/3,
+	// p(Bad|offer) = 1/2), so Bad's chi2 is smaller and its Fisher
+	// score (1 - CDF) is larger.
+	if scores[1] <= scores[0] {
+		t.Fatalf("expected Bad's score to exceed Good's, got scores=%v", scores)
+	}
+	if inx != 1 {
+		t.Fatalf("expected Bad (inx=1) to win, got inx=%d scores=%v", inx, scores)
+	}
+}
+
+// TestFisherScoresThresholdAndMinimum checks that classifyFisher
+// falls back to UnknownClass once a configured Threshold or Minimum
+// is not cleared by the winning class.
+func TestFisherScoresThresholdAndMinimum(t *testing.T) {
+	c := NewClassifier(testGood, testBad)
+	c.Learn([]string{"cheap", "offer"}, testGood)
+	c.Learn([]string{"cheap", "cheap", "offer"}, testBad)
+
+	c.Minimums = map[Class]float64{testBad: 1.1}
+	_, inx, _ := c.FisherScores([]string{"cheap", "offer"})
+	if inx != UnknownClass {
+		t.Fatalf("expected UnknownClass when Bad's score can't clear its Minimum, got inx=%d", inx)
+	}
+
+	c.Minimums = nil
+	c.Thresholds = map[Class]float64{testBad: 1000}
+	_, inx, _ = c.FisherScores([]string{"cheap", "offer"})
+	if inx != UnknownClass {
+		t.Fatalf("expected UnknownClass when Bad's score can't clear its Threshold, got inx=%d", inx)
+	}
+}
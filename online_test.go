@@ -0,0 +1,123 @@
+package bayesian
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestOnlineLearn checks that OnlineLearn learns every valid sample,
+// reports per-sample problems on errs without stopping consumption,
+// and returns once stream is closed.
+func TestOnlineLearn(t *testing.T) {
+	c := NewClassifier(testGood, testBad)
+
+	stream := make(chan TrainingSample)
+	errs := make(chan error, 4)
+	done := make(chan struct{})
+
+	go func() {
+		c.OnlineLearn(context.Background(), stream, errs)
+		close(done)
+	}()
+
+	stream <- TrainingSample{Document: []string{"cheap", "offer"}, Class: testGood}
+	stream <- TrainingSample{Document: nil, Class: testGood}
+	stream <- TrainingSample{Document: []string{"cheap"}, Class: "Unknown"}
+	stream <- TrainingSample{Document: []string{"cheap", "viagra"}, Class: testBad}
+	close(stream)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("OnlineLearn did not return after stream was closed")
+	}
+
+	if c.WordsByClass(testGood)["offer"] == 0 {
+		t.Fatalf("expected the valid Good sample to be learned, got %v", c.WordsByClass(testGood))
+	}
+	if c.WordsByClass(testBad)["viagra"] == 0 {
+		t.Fatalf("expected the valid Bad sample to be learned, got %v", c.WordsByClass(testBad))
+	}
+
+	close(errs)
+	var got []error
+	for err := range errs {
+		got = append(got, err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 errors (empty document, unknown class), got %d: %v", len(got), got)
+	}
+}
+
+// TestOnlineLearnCancellation checks that OnlineLearn returns
+// promptly once ctx is cancelled, even with no one reading stream.
+func TestOnlineLearnCancellation(t *testing.T) {
+	c := NewClassifier(testGood, testBad)
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := make(chan TrainingSample)
+	done := make(chan struct{})
+
+	go func() {
+		c.OnlineLearn(ctx, stream, nil)
+		close(done)
+	}()
+
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("OnlineLearn did not return after ctx was cancelled")
+	}
+}
+
+// TestOnlineClassify checks that OnlineClassify classifies each
+// document from in and reports an error result for an empty document
+// instead of scoring it, until in is closed.
+func TestOnlineClassify(t *testing.T) {
+	c := NewClassifier(testGood, testBad)
+	c.Learn([]string{"cheap", "offer"}, testGood)
+	c.Learn([]string{"cheap", "viagra"}, testBad)
+
+	in := make(chan []string)
+	out := make(chan ClassificationResult)
+	done := make(chan struct{})
+
+	go func() {
+		c.OnlineClassify(context.Background(), in, out)
+		close(done)
+	}()
+
+	go func() {
+		in <- []string{"cheap", "viagra"}
+		in <- nil
+		close(in)
+	}()
+
+	results := make([]ClassificationResult, 0, 2)
+	for i := 0; i < 2; i++ {
+		select {
+		case r := <-out:
+			results = append(results, r)
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for result %d", i)
+		}
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("OnlineClassify did not return after in was closed")
+	}
+
+	if results[0].Err != nil {
+		t.Fatalf("unexpected error for a real document: %v", results[0].Err)
+	}
+	if results[0].Inx != 1 {
+		t.Fatalf("expected Bad (inx=1) to win, got %+v", results[0])
+	}
+	if results[1].Err == nil {
+		t.Fatalf("expected an error for the empty document, got %+v", results[1])
+	}
+}